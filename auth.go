@@ -0,0 +1,136 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthenticated and ErrForbidden are returned by an Authorizer to
+// indicate why a request was rejected; RESTHandler maps the former to 401
+// and the latter (and anything else) to 403.
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// principalContextKey is unexported so only this package can set or read
+// the Principal stashed in a request's context.
+type principalContextKey struct{}
+
+// Principal identifies whoever Authorize resolved a request's credentials
+// to. Model methods can pull it back out of the ctx threaded through
+// ContextModel to perform row-level checks.
+type Principal interface {
+	ID() string
+}
+
+// PrincipalFromContext returns the Principal attached by an Authorizer, if
+// any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+// Authorizer is consulted by RESTHandler before dispatching to the Model.
+// method is the HTTP verb ("GET", "PUT", ...); key is the resource key, or
+// "" for a collection-level request.
+type Authorizer interface {
+	Authorize(r *http.Request, method, key string) (Principal, error)
+}
+
+func (h *RESTHandler) authorize(w http.ResponseWriter, r *http.Request, method, key string) (*http.Request, bool) {
+	if h.Authorizer == nil {
+		return r, true
+	}
+	principal, err := h.Authorizer.Authorize(r, method, key)
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			writeError(w, ErrUnauthenticated)
+		} else {
+			writeError(w, ErrForbidden)
+		}
+		return r, false
+	}
+	if principal != nil {
+		r = r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal))
+	}
+	return r, true
+}
+
+// stringPrincipal is the Principal produced by the built-in authorizers,
+// which only need to carry an identifier (a username or a token's subject).
+type stringPrincipal string
+
+func (p stringPrincipal) ID() string { return string(p) }
+
+// BasicAuthorizer authenticates requests via HTTP Basic auth, checking the
+// supplied username/password against Verify.
+type BasicAuthorizer struct {
+	// Verify reports whether user/password is a valid credential pair.
+	Verify func(user, password string) bool
+}
+
+func (a BasicAuthorizer) Authorize(r *http.Request, method, key string) (Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok || !a.Verify(user, password) {
+		return nil, ErrUnauthenticated
+	}
+	return stringPrincipal(user), nil
+}
+
+// BearerAuthorizer authenticates requests via an "Authorization: Bearer
+// <token>" header, resolving the token to a Principal via Verify.
+type BearerAuthorizer struct {
+	Verify func(token string) (Principal, error)
+}
+
+func (a BearerAuthorizer) Authorize(r *http.Request, method, key string) (Principal, error) {
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return nil, ErrUnauthenticated
+	}
+	token := strings.TrimPrefix(header, prefix)
+	principal, err := a.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return principal, nil
+}
+
+// AuthorizerFunc adapts a plain function to an Authorizer, for callers
+// wiring up JWT validation, a session store, or any other custom scheme.
+type AuthorizerFunc func(r *http.Request, method, key string) (Principal, error)
+
+func (f AuthorizerFunc) Authorize(r *http.Request, method, key string) (Principal, error) {
+	return f(r, method, key)
+}
+
+// ReadOnly rejects every method except GET and HEAD with ErrForbidden,
+// regardless of credentials. It is meant to be composed with a real
+// Authorizer when an endpoint should be publicly readable but never
+// writable; wrap it with AuthorizerFunc to delegate GET/HEAD elsewhere.
+type ReadOnly struct{}
+
+func (ReadOnly) Authorize(r *http.Request, method, key string) (Principal, error) {
+	if method == "GET" || method == "HEAD" {
+		return nil, nil
+	}
+	return nil, ErrForbidden
+}
@@ -0,0 +1,92 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"github.com/johncylee/goroute"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestReadOnlyAuthorizerRejectsWrites(t *testing.T) {
+	h := RESTHandler{
+		Name:       "ro",
+		Model:      &Model{},
+		DataType:   reflect.TypeOf(KeyValue{}),
+		Authorizer: ReadOnly{},
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	req, err := http.NewRequest("DELETE", s.URL+"/Peter", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", res.StatusCode)
+	}
+}
+
+func TestBasicAuthorizerRejectsBadCredentials(t *testing.T) {
+	h := RESTHandler{
+		Name:     "basic",
+		Model:    &Model{},
+		DataType: reflect.TypeOf(KeyValue{}),
+		Authorizer: BasicAuthorizer{
+			Verify: func(user, password string) bool {
+				return user == "admin" && password == "secret"
+			},
+		},
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	dataStore["AuthUser"] = "hello"
+	defer delete(dataStore, "AuthUser")
+
+	res, err := http.Get(s.URL + "/AuthUser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", res.StatusCode)
+	}
+
+	req, err := http.NewRequest("GET", s.URL+"/AuthUser", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("admin", "secret")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", res.StatusCode)
+	}
+}
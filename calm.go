@@ -0,0 +1,394 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gocalm implements a small RESTful HTTP handler that maps the
+// standard HTTP verbs onto a pluggable Model interface, serializing through
+// pluggable Codecs (JSON by default).
+package gocalm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Errors returned by Model implementations. RESTHandler maps each of these
+// to the appropriate HTTP status code.
+var (
+	TypeMismatch       = errors.New("type mismatch")
+	NotFound           = errors.New("not found")
+	AlreadyExists      = errors.New("already exists")
+	PreconditionFailed = errors.New("precondition failed")
+)
+
+// LegacyModel is implemented by the application to back a RESTHandler. Get
+// returns (nil, nil) when key does not exist, rather than NotFound, since
+// the handler treats that as a 404 as well.
+type LegacyModel interface {
+	Get(key string) (interface{}, error)
+	GetAll() (interface{}, error)
+	Put(key string, v interface{}) error
+	PutAll(v interface{}) error
+	Post(v interface{}) (string, error)
+	Delete(key string) error
+	DeleteAll() error
+}
+
+// ContextModel is the context-aware counterpart of LegacyModel. RESTHandler
+// prefers a ContextModel when one is supplied, deriving ctx from the
+// inbound request's r.Context() so a client disconnect or deadline can
+// cancel in-flight work. Implementations of GetAll that push into a
+// channel should select on ctx.Done() around the send so they terminate
+// promptly when the caller stops reading.
+type ContextModel interface {
+	Get(ctx context.Context, key string) (interface{}, error)
+	GetAll(ctx context.Context) (interface{}, error)
+	Put(ctx context.Context, key string, v interface{}) error
+	PutAll(ctx context.Context, v interface{}) error
+	Post(ctx context.Context, v interface{}) (string, error)
+	Delete(ctx context.Context, key string) error
+	DeleteAll(ctx context.Context) error
+}
+
+// legacyModel adapts a LegacyModel to ContextModel for callers that only
+// know about the context-aware interface. ctx is not forwarded anywhere,
+// since the wrapped LegacyModel predates context support and has no way to
+// honor it.
+type legacyModel struct {
+	LegacyModel
+}
+
+func (l legacyModel) Get(ctx context.Context, key string) (interface{}, error) {
+	return l.LegacyModel.Get(key)
+}
+
+func (l legacyModel) GetAll(ctx context.Context) (interface{}, error) {
+	return l.LegacyModel.GetAll()
+}
+
+func (l legacyModel) Put(ctx context.Context, key string, v interface{}) error {
+	return l.LegacyModel.Put(key, v)
+}
+
+func (l legacyModel) PutAll(ctx context.Context, v interface{}) error {
+	return l.LegacyModel.PutAll(v)
+}
+
+func (l legacyModel) Post(ctx context.Context, v interface{}) (string, error) {
+	return l.LegacyModel.Post(v)
+}
+
+func (l legacyModel) Delete(ctx context.Context, key string) error {
+	return l.LegacyModel.Delete(key)
+}
+
+func (l legacyModel) DeleteAll(ctx context.Context) error {
+	return l.LegacyModel.DeleteAll()
+}
+
+// RESTHandler maps HTTP verbs onto a Model and writes responses in the
+// format negotiated from its Codecs. It
+// implements goroute.Handler, and is meant to be wired up via goroute.Handle
+// with a pattern that names the resource key "key" (e.g. "(?P<key>[[:alnum:]]*)"),
+// leaving kvpairs["key"] empty for a collection-level request.
+type RESTHandler struct {
+	Name string
+
+	// Model is the legacy, context-oblivious backing store. Set
+	// ContextModel instead if cancellation support is needed.
+	Model LegacyModel
+
+	// ContextModel, when set, takes precedence over Model and receives a
+	// context derived from each request.
+	ContextModel ContextModel
+
+	DataType   reflect.Type
+	Expiration int64 // response cache lifetime, in seconds
+
+	// Codecs lists the wire formats this handler can speak, used both to
+	// negotiate the response format against the request's Accept header
+	// and to pick a decoder for the request body based on Content-Type.
+	// Defaults to JSON alone when unset.
+	Codecs []Codec
+
+	// Authorizer, when set, is consulted before every request is
+	// dispatched to the Model. A rejected request never reaches Get,
+	// Put, Post, Delete, or any other Model method.
+	Authorizer Authorizer
+}
+
+func (h *RESTHandler) contextModel() ContextModel {
+	if h.ContextModel != nil {
+		return h.ContextModel
+	}
+	return legacyModel{h.Model}
+}
+
+// key returns the resource key from kv, as parsed by goroute from the
+// "key" named submatch. It falls back to trimming r.URL.Path for callers
+// that invoke ServeHTTP directly, without a goroute router in front.
+func key(r *http.Request, kv map[string]string) string {
+	if k, ok := kv["key"]; ok {
+		return k
+	}
+	return strings.Trim(r.URL.Path, "/")
+}
+
+func (h *RESTHandler) setCacheHeaders(w http.ResponseWriter) {
+	if h.Expiration > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", h.Expiration))
+	}
+}
+
+func (h *RESTHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, kv map[string]string) {
+	codec, ok := negotiate(h.Codecs, r.Header.Get("Accept"))
+	if !ok {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+	k := key(r, kv)
+	r, ok = h.authorize(w, r, r.Method, k)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case "GET":
+		if k == "" {
+			h.getAll(w, r, codec)
+		} else {
+			h.get(w, r, k, codec)
+		}
+	case "PUT":
+		if k == "" {
+			h.putAll(w, r)
+		} else {
+			h.put(w, r, k)
+		}
+	case "POST":
+		h.post(w, r)
+	case "DELETE":
+		if k == "" {
+			h.deleteAll(w, r)
+		} else {
+			h.delete(w, r, k)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *RESTHandler) get(w http.ResponseWriter, r *http.Request, k string, codec Codec) {
+	var etag string
+	var modTime time.Time
+	if versioned, ok := h.versioned(); ok {
+		var err error
+		etag, modTime, err = versioned.ETag(k)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if etag != "" && checkConditionalGet(r, etag, modTime) {
+			setVersionHeaders(w, etag, modTime)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	v, err := h.contextModel().Get(r.Context(), k)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	b, err := codec.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.setCacheHeaders(w)
+	setVersionHeaders(w, etag, modTime)
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.Write(b)
+}
+
+// getAll streams the collection through codec's StreamStart/StreamItem/
+// StreamEnd framing. When the Model implements QueryableModel, List is
+// used instead of GetAll so the query string's limit/offset/cursor/sort/
+// filter parameters take effect and the response carries pagination
+// headers. Otherwise, when the Model returns a channel, items are
+// forwarded as they arrive, selecting on r.Context().Done() so a client
+// that disconnects (or whose request is canceled) lets the handler
+// return instead of blocking forever on the channel receive.
+func (h *RESTHandler) getAll(w http.ResponseWriter, r *http.Request, codec Codec) {
+	if qm, ok := h.queryable(); ok {
+		h.list(w, r, codec, qm)
+		return
+	}
+
+	result, err := h.contextModel().GetAll(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.setCacheHeaders(w)
+	w.Header().Set("Content-Type", codec.ContentType())
+	codec.StreamStart(w)
+	defer codec.StreamEnd(w)
+
+	ch, isChan := result.(chan interface{})
+	if !isChan {
+		v := reflect.ValueOf(result)
+		for i := 0; i < v.Len(); i++ {
+			codec.StreamItem(w, v.Index(i).Interface(), i == 0)
+		}
+		return
+	}
+
+	ctx := r.Context()
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item, more := <-ch:
+			if !more {
+				return
+			}
+			codec.StreamItem(w, item, first)
+			first = false
+		}
+	}
+}
+
+// list serves the root GET via QueryableModel.List, parsing Limit/Offset/
+// Cursor/Sort/Filter from the URL query string and emitting a Link: rel
+// ="next" header for the returned page's NextCursor.
+func (h *RESTHandler) list(w http.ResponseWriter, r *http.Request, codec Codec, qm QueryableModel) {
+	page, err := qm.List(r.Context(), parseQuery(r.URL.Query()))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.setCacheHeaders(w)
+	writeNextLink(w, r, page)
+	w.Header().Set("Content-Type", codec.ContentType())
+	codec.StreamStart(w)
+	defer codec.StreamEnd(w)
+
+	v := reflect.ValueOf(page.Items)
+	if !v.IsValid() {
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		codec.StreamItem(w, v.Index(i).Interface(), i == 0)
+	}
+}
+
+func (h *RESTHandler) decode(r *http.Request, out interface{}) error {
+	defer r.Body.Close()
+	codec := codecFor(h.Codecs, r.Header.Get("Content-Type"))
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, out)
+}
+
+func (h *RESTHandler) put(w http.ResponseWriter, r *http.Request, k string) {
+	if versioned, ok := h.versioned(); ok {
+		etag, modTime, err := versioned.ETag(k)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := checkConditionalWrite(r, etag, modTime); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	v := reflect.New(h.DataType).Interface()
+	if err := h.decode(r, v); err != nil {
+		writeError(w, TypeMismatch)
+		return
+	}
+	if err := h.contextModel().Put(r.Context(), k, v); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+func (h *RESTHandler) putAll(w http.ResponseWriter, r *http.Request) {
+	slicePtr := reflect.New(reflect.SliceOf(h.DataType))
+	if err := h.decode(r, slicePtr.Interface()); err != nil {
+		writeError(w, TypeMismatch)
+		return
+	}
+	if err := h.contextModel().PutAll(r.Context(), slicePtr.Elem().Interface()); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+func (h *RESTHandler) post(w http.ResponseWriter, r *http.Request) {
+	v := reflect.New(h.DataType).Interface()
+	if err := h.decode(r, v); err != nil {
+		writeError(w, TypeMismatch)
+		return
+	}
+	newKey, err := h.contextModel().Post(r.Context(), v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Write([]byte(newKey))
+}
+
+func (h *RESTHandler) delete(w http.ResponseWriter, r *http.Request, k string) {
+	if versioned, ok := h.versioned(); ok {
+		etag, modTime, err := versioned.ETag(k)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := checkConditionalWrite(r, etag, modTime); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	if err := h.contextModel().Delete(r.Context(), k); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+func (h *RESTHandler) deleteAll(w http.ResponseWriter, r *http.Request) {
+	if err := h.contextModel().DeleteAll(r.Context()); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
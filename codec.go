@@ -0,0 +1,309 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes and decodes the values a RESTHandler passes to and from its
+// Model. StreamStart/StreamItem/StreamEnd frame a collection response (used
+// by getAll) so formats that need a wrapping element, such as XML, can
+// write one without the rest of the handler knowing the wire format.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	StreamStart(w io.Writer) error
+	StreamItem(w io.Writer, v interface{}, first bool) error
+	StreamEnd(w io.Writer) error
+}
+
+// JSONCodec is the default Codec and reproduces RESTHandler's original
+// wire format: a bare value for single items, and a bracketed,
+// comma-separated array for collections.
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return "application/json" }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (JSONCodec) StreamStart(w io.Writer) error {
+	_, err := w.Write([]byte("["))
+	return err
+}
+
+func (JSONCodec) StreamItem(w io.Writer, v interface{}, first bool) error {
+	if !first {
+		if _, err := w.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (JSONCodec) StreamEnd(w io.Writer) error {
+	_, err := w.Write([]byte("]"))
+	return err
+}
+
+// XMLCodec marshals collections inside a wrapping <results> root element,
+// since XML (unlike JSON) has no native way to denote a top-level array.
+type XMLCodec struct {
+	// Root names the wrapping element emitted by StreamStart/StreamEnd.
+	// Defaults to "results" when empty.
+	Root string
+}
+
+func (XMLCodec) ContentType() string { return "application/xml" }
+
+func (XMLCodec) Marshal(v interface{}) ([]byte, error) { return xml.Marshal(v) }
+
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+func (c XMLCodec) root() string {
+	if c.Root == "" {
+		return "results"
+	}
+	return c.Root
+}
+
+func (c XMLCodec) StreamStart(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "<%s>", c.root())
+	return err
+}
+
+func (c XMLCodec) StreamItem(w io.Writer, v interface{}, first bool) error {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (c XMLCodec) StreamEnd(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "</%s>", c.root())
+	return err
+}
+
+// FormCodec encodes and decodes application/x-www-form-urlencoded bodies
+// by reflecting over the exported fields of a struct (or struct pointer).
+// It has no natural representation for a streamed collection, so
+// StreamItem joins each item's encoded form with "&" for responses, but
+// that join can't be reversed unambiguously: repeated field names across
+// items would collide. Unmarshal rejects a slice destination with
+// errFormCollectionUnsupported instead of silently misreading the body, so
+// PutAll is unsupported with this codec.
+type FormCodec struct{}
+
+func (FormCodec) ContentType() string { return "application/x-www-form-urlencoded" }
+
+func (FormCodec) Marshal(v interface{}) ([]byte, error) {
+	values, err := structToValues(v)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(values.Encode()), nil
+}
+
+// errFormCollectionUnsupported is returned by FormCodec.Unmarshal when
+// asked to decode into a slice, since application/x-www-form-urlencoded
+// has no standard way to delimit repeated structs within a single body.
+var errFormCollectionUnsupported = errors.New("gocalm: FormCodec cannot decode a collection body")
+
+func (FormCodec) Unmarshal(data []byte, v interface{}) error {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Slice {
+		return errFormCollectionUnsupported
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	return valuesToStruct(values, v)
+}
+
+func (FormCodec) StreamStart(w io.Writer) error { return nil }
+
+func (c FormCodec) StreamItem(w io.Writer, v interface{}, first bool) error {
+	if !first {
+		if _, err := w.Write([]byte("&")); err != nil {
+			return err
+		}
+	}
+	b, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (FormCodec) StreamEnd(w io.Writer) error { return nil }
+
+func structToValues(v interface{}) (url.Values, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, TypeMismatch
+	}
+	values := url.Values{}
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		values.Set(field.Name, fmt.Sprintf("%v", rv.Field(i).Interface()))
+	}
+	return values, nil
+}
+
+func valuesToStruct(values url.Values, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return TypeMismatch
+	}
+	rv = rv.Elem()
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		raw := values.Get(field.Name)
+		if raw == "" {
+			continue
+		}
+		fv := rv.Field(i)
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(raw)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return TypeMismatch
+			}
+			fv.SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return TypeMismatch
+			}
+			fv.SetBool(b)
+		default:
+			return TypeMismatch
+		}
+	}
+	return nil
+}
+
+// defaultCodecs is used by RESTHandler when Codecs is unset.
+var defaultCodecs = []Codec{JSONCodec{}}
+
+type acceptCandidate struct {
+	codec Codec
+	q     float64
+}
+
+// negotiate picks the Codec best matching the request's Accept header,
+// honoring quality values (e.g. "application/xml;q=0.9"), and returns
+// false if none of the handler's codecs are acceptable.
+func negotiate(codecs []Codec, acceptHeader string) (Codec, bool) {
+	if len(codecs) == 0 {
+		codecs = defaultCodecs
+	}
+	if strings.TrimSpace(acceptHeader) == "" {
+		return codecs[0], true
+	}
+	var candidates []acceptCandidate
+	for _, part := range strings.Split(acceptHeader, ",") {
+		mediaType, q := parseAcceptPart(part)
+		if q <= 0 {
+			continue // q=0 marks the media type as not acceptable
+		}
+		if mediaType == "*/*" {
+			candidates = append(candidates, acceptCandidate{codecs[0], q})
+			continue
+		}
+		for _, c := range codecs {
+			if mediaTypeMatches(mediaType, c.ContentType()) {
+				candidates = append(candidates, acceptCandidate{c, q})
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].codec, true
+}
+
+func mediaTypeMatches(accept, contentType string) bool {
+	if accept == contentType {
+		return true
+	}
+	acceptType := strings.SplitN(accept, "/", 2)
+	ctType := strings.SplitN(contentType, "/", 2)
+	return len(acceptType) == 2 && acceptType[1] == "*" && acceptType[0] == ctType[0]
+}
+
+func parseAcceptPart(part string) (mediaType string, q float64) {
+	q = 1.0
+	fields := strings.Split(part, ";")
+	mediaType = strings.TrimSpace(fields[0])
+	for _, p := range fields[1:] {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "q=") {
+			if parsed, err := strconv.ParseFloat(strings.TrimPrefix(p, "q="), 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return mediaType, q
+}
+
+// codecFor returns the Codec matching a Content-Type header, falling back
+// to the first configured codec when the header is absent or unmatched.
+func codecFor(codecs []Codec, contentType string) Codec {
+	if len(codecs) == 0 {
+		codecs = defaultCodecs
+	}
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	for _, c := range codecs {
+		if mediaType == c.ContentType() {
+			return c
+		}
+	}
+	return codecs[0]
+}
@@ -0,0 +1,170 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"github.com/johncylee/goroute"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateQualityValues(t *testing.T) {
+	codecs := []Codec{JSONCodec{}, XMLCodec{}}
+	codec, ok := negotiate(codecs, "application/xml;q=0.9, application/json;q=0.1")
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if codec.ContentType() != "application/xml" {
+		t.Errorf("expected application/xml to win on q value, got %s", codec.ContentType())
+	}
+}
+
+func TestNegotiateNoMatch(t *testing.T) {
+	if _, ok := negotiate([]Codec{JSONCodec{}}, "text/html"); ok {
+		t.Error("expected no codec to match text/html")
+	}
+}
+
+func TestXMLStreaming(t *testing.T) {
+	codec := XMLCodec{}
+	var buf strings.Builder
+	codec.StreamStart(&buf)
+	codec.StreamItem(&buf, &KeyValue{Key: "a", Value: "1"}, true)
+	codec.StreamItem(&buf, &KeyValue{Key: "b", Value: "2"}, false)
+	codec.StreamEnd(&buf)
+	got := buf.String()
+	if !strings.HasPrefix(got, "<results>") || !strings.HasSuffix(got, "</results>") {
+		t.Errorf("expected wrapped root element, got %s", got)
+	}
+}
+
+func TestRestfulXML(t *testing.T) {
+	h := RESTHandler{
+		Name:     "test-xml",
+		Model:    &Model{},
+		DataType: reflect.TypeOf(KeyValue{}),
+		Codecs:   []Codec{JSONCodec{}, XMLCodec{}},
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	dataStore["XMLUser"] = "hello"
+	defer delete(dataStore, "XMLUser")
+
+	client := http.Client{}
+	req, err := http.NewRequest("GET", s.URL+"/XMLUser", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/xml")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != "application/xml" {
+		t.Errorf("expected application/xml content type, got %s", res.Header.Get("Content-Type"))
+	}
+}
+
+func TestFormCodecRoundTrip(t *testing.T) {
+	codec := FormCodec{}
+	b, err := codec.Marshal(&KeyValue{Key: "a", Value: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got KeyValue
+	if err := codec.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (KeyValue{Key: "a", Value: "1"}) {
+		t.Errorf("expected round-tripped KeyValue{a, 1}, got %+v", got)
+	}
+}
+
+func TestFormCodecUnmarshalRejectsCollection(t *testing.T) {
+	codec := FormCodec{}
+	var got []KeyValue
+	if err := codec.Unmarshal([]byte("Key=a&Value=1"), &got); err != errFormCollectionUnsupported {
+		t.Errorf("expected errFormCollectionUnsupported, got %v", err)
+	}
+}
+
+func TestRestfulForm(t *testing.T) {
+	h := RESTHandler{
+		Name:     "test-form",
+		Model:    &Model{},
+		DataType: reflect.TypeOf(KeyValue{}),
+		Codecs:   []Codec{JSONCodec{}, FormCodec{}},
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	dataStore["FormUser"] = "hello"
+	defer delete(dataStore, "FormUser")
+
+	client := http.Client{}
+	req, err := http.NewRequest("PUT", s.URL+"/FormUser", strings.NewReader("Value=world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", res.StatusCode)
+	}
+	if dataStore["FormUser"] != "world" {
+		t.Errorf("expected FormUser updated to world, got %q", dataStore["FormUser"])
+	}
+}
+
+func TestRestfulFormPutAllUnsupported(t *testing.T) {
+	h := RESTHandler{
+		Name:     "test-form",
+		Model:    &Model{},
+		DataType: reflect.TypeOf(KeyValue{}),
+		Codecs:   []Codec{JSONCodec{}, FormCodec{}},
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	client := http.Client{}
+	req, err := http.NewRequest("PUT", s.URL+"/", strings.NewReader("Key=a&Value=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", res.StatusCode)
+	}
+}
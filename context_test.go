@@ -0,0 +1,100 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"context"
+	"github.com/johncylee/goroute"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// slowModel is a ContextModel whose GetAll never finishes on its own,
+// forcing callers to rely on ctx cancellation to stop the producer.
+type slowModel struct{}
+
+func (slowModel) Get(ctx context.Context, key string) (interface{}, error) { return nil, nil }
+
+func (slowModel) GetAll(ctx context.Context) (interface{}, error) {
+	c := make(chan interface{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case c <- &KeyValue{Key: "k", Value: "v"}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (slowModel) Put(ctx context.Context, key string, v interface{}) error  { return nil }
+func (slowModel) PutAll(ctx context.Context, v interface{}) error          { return nil }
+func (slowModel) Post(ctx context.Context, v interface{}) (string, error)  { return "", nil }
+func (slowModel) Delete(ctx context.Context, key string) error            { return nil }
+func (slowModel) DeleteAll(ctx context.Context) error                     { return nil }
+
+// TestGetAllCancelationStopsProducer verifies that canceling the client
+// request lets both the handler's streaming loop and the Model's producer
+// goroutine return, rather than leaking a goroutine blocked forever on the
+// unbuffered channel send.
+func TestGetAllCancelationStopsProducer(t *testing.T) {
+	h := RESTHandler{
+		Name:         "slow",
+		ContextModel: slowModel{},
+		DataType:     reflect.TypeOf(KeyValue{}),
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", s.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(ctx)
+
+	// Start the request, read a few bytes to be sure streaming began, then
+	// cancel it mid-stream.
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	if _, err := res.Body.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	res.Body.Close()
+
+	// Give the server goroutine time to notice ctx.Done() and unwind.
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if runtime.NumGoroutine() <= before+1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("goroutines leaked: before=%d, after=%d", before, runtime.NumGoroutine())
+}
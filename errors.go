@@ -0,0 +1,133 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// HTTPError is a machine-readable failure response following RFC 7807
+// (application/problem+json). A Model method can return one directly, or
+// wrap one with fmt.Errorf("...: %w", httpErr) and RESTHandler will find
+// it via errors.As.
+type HTTPError struct {
+	Status     int                    `json:"status"`
+	Type       string                 `json:"type,omitempty"`
+	Title      string                 `json:"title"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (e *HTTPError) Error() string { return e.Title }
+
+// MarshalJSON flattens Extensions alongside the standard RFC 7807 members,
+// per the RFC's "extension members" convention.
+func (e *HTTPError) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{
+		"status": e.Status,
+		"title":  e.Title,
+	}
+	if e.Type != "" {
+		fields["type"] = e.Type
+	}
+	if e.Detail != "" {
+		fields["detail"] = e.Detail
+	}
+	if e.Instance != "" {
+		fields["instance"] = e.Instance
+	}
+	for k, v := range e.Extensions {
+		fields[k] = v
+	}
+	return json.Marshal(fields)
+}
+
+// errorTable maps the sentinel errors Model implementations already
+// return to their RFC 7807 representation.
+var errorTable = map[error]*HTTPError{
+	TypeMismatch: {
+		Status: http.StatusBadRequest,
+		Title:  "Type Mismatch",
+		Type:   "about:blank",
+		Detail: "the request body did not match the resource's data type",
+	},
+	NotFound: {
+		Status: http.StatusNotFound,
+		Title:  "Not Found",
+		Type:   "about:blank",
+		Detail: "no resource exists for the given key",
+	},
+	AlreadyExists: {
+		Status: http.StatusConflict,
+		Title:  "Already Exists",
+		Type:   "about:blank",
+		Detail: "a resource already exists for the given key",
+	},
+	PreconditionFailed: {
+		Status: http.StatusPreconditionFailed,
+		Title:  "Precondition Failed",
+		Type:   "about:blank",
+		Detail: "the resource has changed since the conditional header was generated",
+	},
+	ErrUnauthenticated: {
+		Status: http.StatusUnauthorized,
+		Title:  "Unauthorized",
+		Type:   "about:blank",
+		Detail: "valid credentials are required to access this resource",
+	},
+	ErrForbidden: {
+		Status: http.StatusForbidden,
+		Title:  "Forbidden",
+		Type:   "about:blank",
+		Detail: "the credentials supplied do not permit this request",
+	},
+}
+
+// httpErrorFor resolves any error returned by a Model into an *HTTPError,
+// preferring one it already wraps (via errors.As), then the sentinel
+// table, then a generic 500.
+func httpErrorFor(err error) *HTTPError {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+	if mapped, ok := errorTable[err]; ok {
+		return mapped
+	}
+	return &HTTPError{
+		Status: http.StatusInternalServerError,
+		Title:  "Internal Server Error",
+		Type:   "about:blank",
+		Detail: err.Error(),
+	}
+}
+
+// writeError serializes err as application/problem+json per RFC 7807,
+// regardless of the codec negotiated for the success path — problem+json
+// is its own content type, not one of RESTHandler's Codecs.
+func writeError(w http.ResponseWriter, err error) {
+	he := httpErrorFor(err)
+	b, marshalErr := json.Marshal(he)
+	if marshalErr != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(he.Status)
+	w.Write(b)
+}
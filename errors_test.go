@@ -0,0 +1,115 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"encoding/json"
+	"github.com/johncylee/goroute"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPutMissingKeyServesProblemJSON(t *testing.T) {
+	h := RESTHandler{
+		Name:     "test",
+		Model:    &Model{},
+		DataType: reflect.TypeOf(KeyValue{}),
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	req, err := http.NewRequest("PUT", s.URL+"/NoSuchUser", strings.NewReader(`{"Value":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", res.StatusCode)
+	}
+	if res.Header.Get("Content-Type") != "application/problem+json" {
+		t.Errorf("expected application/problem+json, got %s", res.Header.Get("Content-Type"))
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["title"] != "Not Found" {
+		t.Errorf("expected title Not Found, got %v", body["title"])
+	}
+}
+
+func TestAuthRejectionServesProblemJSON(t *testing.T) {
+	h := RESTHandler{
+		Name:       "ro",
+		Model:      &Model{},
+		DataType:   reflect.TypeOf(KeyValue{}),
+		Authorizer: ReadOnly{},
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	req, err := http.NewRequest("DELETE", s.URL+"/Peter", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", res.StatusCode)
+	}
+	if res.Header.Get("Content-Type") != "application/problem+json" {
+		t.Errorf("expected application/problem+json, got %s", res.Header.Get("Content-Type"))
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["title"] != "Forbidden" {
+		t.Errorf("expected title Forbidden, got %v", body["title"])
+	}
+}
+
+func TestHTTPErrorMarshalsRFC7807Fields(t *testing.T) {
+	he := httpErrorFor(AlreadyExists)
+	b, err := json.Marshal(he)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["status"] != float64(http.StatusConflict) {
+		t.Errorf("expected status 409, got %v", decoded["status"])
+	}
+	if decoded["title"] != "Already Exists" {
+		t.Errorf("expected title, got %v", decoded["title"])
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Versioned is an optional interface a Model (or ContextModel) can
+// implement to report a resource's current ETag and modification time.
+// RESTHandler uses it to answer conditional GETs with 304 Not Modified and
+// to reject stale PUT/DELETE requests with 412 Precondition Failed. A zero
+// time.Time means "no modification time available"; an empty etag means
+// "no ETag available", in which case a GET skips conditional handling,
+// while a PUT/DELETE carrying If-Match is rejected since nothing matches.
+type Versioned interface {
+	ETag(key string) (string, time.Time, error)
+}
+
+func (h *RESTHandler) versioned() (Versioned, bool) {
+	if v, ok := h.ContextModel.(Versioned); ok {
+		return v, true
+	}
+	if v, ok := h.Model.(Versioned); ok {
+		return v, true
+	}
+	return nil, false
+}
+
+func etagMatches(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag || candidate == "W/"+etag {
+			return true
+		}
+	}
+	return false
+}
+
+func setVersionHeaders(w http.ResponseWriter, etag string, modTime time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+// checkConditionalGet reports whether the request's If-None-Match or
+// If-Modified-Since header shows the client's cached copy is still
+// current, meaning the handler should answer with 304 Not Modified.
+func checkConditionalGet(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil && !modTime.IsZero() && !modTime.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConditionalWrite returns PreconditionFailed when the request's
+// If-Match or If-Unmodified-Since header shows the caller's view of the
+// resource is stale, so PUT/DELETE can reject it with 412 rather than
+// clobbering a concurrent update.
+func checkConditionalWrite(r *http.Request, etag string, modTime time.Time) error {
+	if im := r.Header.Get("If-Match"); im != "" && !etagMatches(im, etag) {
+		return PreconditionFailed
+	}
+	if ius := r.Header.Get("If-Unmodified-Since"); ius != "" {
+		if t, err := http.ParseTime(ius); err == nil && modTime.After(t) {
+			return PreconditionFailed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"context"
+	"github.com/johncylee/goroute"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// versionedModel is a ContextModel that also implements Versioned, backed
+// by the same shape of data as Model but with a fixed, known ETag so tests
+// don't need real storage semantics.
+type versionedModel struct {
+	slowModel
+	etag string
+}
+
+func (m versionedModel) Get(ctx context.Context, key string) (interface{}, error) {
+	return &KeyValue{Key: key, Value: "v"}, nil
+}
+
+func (m versionedModel) ETag(key string) (string, time.Time, error) {
+	return m.etag, time.Unix(1000, 0), nil
+}
+
+func TestConditionalGetReturns304(t *testing.T) {
+	h := RESTHandler{
+		Name:         "versioned",
+		ContextModel: versionedModel{etag: `"abc"`},
+		DataType:     reflect.TypeOf(KeyValue{}),
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	client := http.Client{}
+	req, err := http.NewRequest("GET", s.URL+"/x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", `"abc"`)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", res.StatusCode)
+	}
+}
+
+func TestConditionalPutRejectsStaleETag(t *testing.T) {
+	h := RESTHandler{
+		Name:         "versioned",
+		ContextModel: versionedModel{etag: `"abc"`},
+		DataType:     reflect.TypeOf(KeyValue{}),
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	client := http.Client{}
+	req, err := http.NewRequest("PUT", s.URL+"/x", strings.NewReader(`{"Value":"new"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"stale"`)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412, got %d", res.StatusCode)
+	}
+}
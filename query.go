@@ -0,0 +1,129 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SortKey orders a List result by Field, ascending unless Desc is set.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Query carries the pagination, sorting, and filtering parameters parsed
+// from a collection GET's query string. Cursor is an opaque continuation
+// token; Limit/Offset are used instead when the Model prefers numeric
+// paging. Filter holds every other query parameter verbatim, keyed by
+// field name, so a Model can interpret them however it likes (equality,
+// ranges, full text, ...).
+type Query struct {
+	Limit  int
+	Offset int
+	Cursor string
+	Sort   []SortKey
+	Filter map[string][]string
+}
+
+// Page is returned by QueryableModel.List. NextCursor is empty when there
+// is no further page.
+type Page struct {
+	Items      interface{}
+	NextCursor string
+	Total      int // -1 when unknown
+}
+
+// QueryableModel is implemented by a Model that can answer paginated,
+// filtered, sorted collection queries directly, rather than having
+// RESTHandler pull the entire collection through GetAll. When a Model
+// implements it, the handler prefers List over GetAll for the root GET.
+type QueryableModel interface {
+	List(ctx context.Context, q Query) (Page, error)
+}
+
+var reservedQueryParams = map[string]bool{
+	"limit":  true,
+	"offset": true,
+	"cursor": true,
+	"sort":   true,
+}
+
+// parseQuery turns a collection GET's URL query string into a Query. Sort
+// fields are given as a comma-separated list, with a leading "-" marking
+// descending order (e.g. "sort=-created,name"). Every other parameter is
+// collected into Filter so a QueryableModel can interpret it.
+func parseQuery(values url.Values) Query {
+	q := Query{
+		Offset: 0,
+		Filter: map[string][]string{},
+	}
+	if limit, err := strconv.Atoi(values.Get("limit")); err == nil {
+		q.Limit = limit
+	}
+	if offset, err := strconv.Atoi(values.Get("offset")); err == nil {
+		q.Offset = offset
+	}
+	q.Cursor = values.Get("cursor")
+	if sort := values.Get("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			if strings.HasPrefix(field, "-") {
+				q.Sort = append(q.Sort, SortKey{Field: field[1:], Desc: true})
+			} else {
+				q.Sort = append(q.Sort, SortKey{Field: field})
+			}
+		}
+	}
+	for key, vals := range values {
+		if reservedQueryParams[key] {
+			continue
+		}
+		q.Filter[key] = vals
+	}
+	return q
+}
+
+// queryable returns the handler's QueryableModel, if its Model or
+// ContextModel implements one.
+func (h *RESTHandler) queryable() (QueryableModel, bool) {
+	if qm, ok := h.ContextModel.(QueryableModel); ok {
+		return qm, true
+	}
+	if qm, ok := h.Model.(QueryableModel); ok {
+		return qm, true
+	}
+	return nil, false
+}
+
+// writeNextLink emits a Link: <...>; rel="next" header (RFC 5988) pointing
+// at the next page, and a total-count header when the Model reported one.
+func writeNextLink(w http.ResponseWriter, r *http.Request, page Page) {
+	if page.Total >= 0 {
+		w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	}
+	if page.NextCursor == "" {
+		return
+	}
+	next := *r.URL
+	values := next.Query()
+	values.Set("cursor", page.NextCursor)
+	next.RawQuery = values.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
@@ -0,0 +1,105 @@
+// Copyright 2013 John Lee <john@0xlab.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gocalm
+
+import (
+	"context"
+	"github.com/johncylee/goroute"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	values, _ := url.ParseQuery("limit=10&offset=20&sort=-created,name&color=red")
+	q := parseQuery(values)
+	if q.Limit != 10 || q.Offset != 20 {
+		t.Errorf("unexpected limit/offset: %+v", q)
+	}
+	if len(q.Sort) != 2 || q.Sort[0] != (SortKey{Field: "created", Desc: true}) || q.Sort[1] != (SortKey{Field: "name"}) {
+		t.Errorf("unexpected sort: %+v", q.Sort)
+	}
+	if reflect.DeepEqual(q.Filter["color"], []string{"red"}) == false {
+		t.Errorf("unexpected filter: %+v", q.Filter)
+	}
+}
+
+type pagedModel struct {
+	slowModel
+}
+
+func (pagedModel) List(ctx context.Context, q Query) (Page, error) {
+	items := []KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}
+	return Page{Items: items, NextCursor: "cursor-2", Total: 2}, nil
+}
+
+func TestListEmitsNextLink(t *testing.T) {
+	h := RESTHandler{
+		Name:         "paged",
+		ContextModel: pagedModel{},
+		DataType:     reflect.TypeOf(KeyValue{}),
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/?limit=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	link := res.Header.Get("Link")
+	if link == "" {
+		t.Fatal("expected a Link header")
+	}
+	if res.Header.Get("X-Total-Count") != "2" {
+		t.Errorf("expected X-Total-Count: 2, got %s", res.Header.Get("X-Total-Count"))
+	}
+}
+
+type emptyPagedModel struct {
+	slowModel
+}
+
+func (emptyPagedModel) List(ctx context.Context, q Query) (Page, error) {
+	return Page{Total: 0}, nil
+}
+
+func TestListServesEmptyPage(t *testing.T) {
+	h := RESTHandler{
+		Name:         "empty",
+		ContextModel: emptyPagedModel{},
+		DataType:     reflect.TypeOf(KeyValue{}),
+	}
+	mux := goroute.NewServeMux()
+	mux.Handle("/", `(?P<key>[[:alnum:]]*)`, &h)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", res.StatusCode)
+	}
+	if res.Header.Get("X-Total-Count") != "0" {
+		t.Errorf("expected X-Total-Count: 0, got %s", res.Header.Get("X-Total-Count"))
+	}
+}